@@ -0,0 +1,196 @@
+// Package cluster lets multiple instances of this server form a peer group
+// and replicate every Put/Delete between them over a gossip connection.
+//
+// Each node keeps a vector of (nodeID -> last applied sequence) to drop
+// events it's already seen, and a per-key Lamport clock to resolve events
+// that arrive for the same key from two different nodes. This is a
+// best-effort v1, not a full vector-clock/CRDT implementation: the
+// per-key conflict check only looks at the single most recent writer, so
+// it catches the common case (two nodes racing to write the same key)
+// without tracking full causal history.
+package cluster
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Hierugu/go-key-value-pair-storage/internal/logging"
+	"github.com/Hierugu/go-key-value-pair-storage/txlog"
+)
+
+// Policy decides what happens when two nodes write the same key concurrently.
+type Policy int
+
+const (
+	LastWriterWins Policy = iota
+	RejectOnConflict
+)
+
+// ParsePolicy accepts the policy names the -cluster-conflict-policy flag
+// understands.
+func ParsePolicy(s string) (Policy, error) {
+	switch s {
+	case "last-writer-wins":
+		return LastWriterWins, nil
+	case "reject-on-conflict":
+		return RejectOnConflict, nil
+	default:
+		return 0, fmt.Errorf("unknown cluster conflict policy %q", s)
+	}
+}
+
+// Frame is one gossiped mutation, tagged with the node that originated it.
+type Frame struct {
+	NodeID string      `json:"node_id"`
+	Event  txlog.Event `json:"event"`
+}
+
+// hello is exchanged when a replication connection is established, so each
+// side knows how much of the other's history it's missing.
+type hello struct {
+	NodeID string            `json:"node_id"`
+	Vector map[string]uint64 `json:"vector"`
+}
+
+// ApplyFunc applies an already conflict-resolved remote event to the local
+// store.
+type ApplyFunc func(e txlog.Event)
+
+// ReplayFunc returns every locally logged event with Sequence > afterSeq, so
+// it can be gossiped to a peer that's behind.
+type ReplayFunc func(afterSeq uint64) []txlog.Event
+
+type keyVersion struct {
+	lamport uint64
+	nodeID  string
+}
+
+// Node is this server's membership in the cluster.
+type Node struct {
+	nodeID string
+	policy Policy
+	apply  ApplyFunc
+	replay ReplayFunc
+	logger *logging.Logger
+
+	mu       sync.Mutex
+	lamport  uint64
+	vector   map[string]uint64
+	keyClock map[string]keyVersion
+	peers    map[*peer]struct{}
+}
+
+// NewNode creates a cluster membership. apply is called for every remote
+// event that survives conflict resolution; replay returns this node's own
+// history so it can be gossiped to peers that reconnect behind.
+func NewNode(nodeID string, policy Policy, apply ApplyFunc, replay ReplayFunc, logger *logging.Logger) *Node {
+	return &Node{
+		nodeID:   nodeID,
+		policy:   policy,
+		apply:    apply,
+		replay:   replay,
+		logger:   logger,
+		vector:   make(map[string]uint64),
+		keyClock: make(map[string]keyVersion),
+		peers:    make(map[*peer]struct{}),
+	}
+}
+
+func (n *Node) NodeID() string { return n.nodeID }
+
+// Broadcast stamps e with a fresh Lamport timestamp and fans it out to
+// every connected peer. It does not block on slow peers: a peer with a full
+// outbound buffer has this frame dropped for it, and catches up on its next
+// reconnect via replay.
+func (n *Node) Broadcast(e txlog.Event) {
+	n.mu.Lock()
+	n.lamport++
+	e.Lamport = n.lamport
+	n.keyClock[e.Key] = keyVersion{lamport: e.Lamport, nodeID: n.nodeID}
+	frame := Frame{NodeID: n.nodeID, Event: e}
+	peers := make([]*peer, 0, len(n.peers))
+	for p := range n.peers {
+		peers = append(peers, p)
+	}
+	n.mu.Unlock()
+
+	for _, p := range peers {
+		select {
+		case p.out <- frame:
+		default:
+			n.logger.Warn("dropping frame for slow peer", logging.F("peer", p.url), logging.F("key", e.Key))
+		}
+	}
+}
+
+// receive applies an incoming frame, resolving conflicts per policy and
+// dropping anything this node has already applied (per the vector clock).
+func (n *Node) receive(f Frame) {
+	n.mu.Lock()
+
+	if f.Event.Lamport > n.lamport {
+		n.lamport = f.Event.Lamport
+	}
+	n.lamport++
+
+	if f.Event.Sequence <= n.vector[f.NodeID] {
+		n.mu.Unlock()
+		return
+	}
+
+	existing, known := n.keyClock[f.Event.Key]
+	conflict := known && existing.nodeID != f.NodeID && f.Event.Lamport <= existing.lamport
+
+	if conflict {
+		n.vector[f.NodeID] = f.Event.Sequence
+
+		if n.policy == RejectOnConflict {
+			n.mu.Unlock()
+			n.logger.Warn("rejecting conflicting event", logging.F("key", f.Event.Key), logging.F("from", f.NodeID))
+			return
+		}
+
+		// LastWriterWins: a lower (or tied-and-smaller-node-id) Lamport
+		// timestamp loses to the write already recorded for this key.
+		if f.Event.Lamport < existing.lamport || (f.Event.Lamport == existing.lamport && f.NodeID <= existing.nodeID) {
+			n.mu.Unlock()
+			return
+		}
+	}
+
+	n.vector[f.NodeID] = f.Event.Sequence
+	n.keyClock[f.Event.Key] = keyVersion{lamport: f.Event.Lamport, nodeID: f.NodeID}
+	n.mu.Unlock()
+
+	n.apply(f.Event)
+}
+
+// Status is a point-in-time snapshot for GET /v1/cluster/status.
+type Status struct {
+	NodeID string            `json:"node_id"`
+	Policy string            `json:"policy"`
+	Vector map[string]uint64 `json:"vector"`
+	Peers  []string          `json:"peers"`
+}
+
+func (n *Node) Status() Status {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	vector := make(map[string]uint64, len(n.vector))
+	for k, v := range n.vector {
+		vector[k] = v
+	}
+
+	peers := make([]string, 0, len(n.peers))
+	for p := range n.peers {
+		peers = append(peers, p.url)
+	}
+
+	policy := "last-writer-wins"
+	if n.policy == RejectOnConflict {
+		policy = "reject-on-conflict"
+	}
+
+	return Status{NodeID: n.nodeID, Policy: policy, Vector: vector, Peers: peers}
+}
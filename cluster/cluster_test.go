@@ -0,0 +1,76 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/Hierugu/go-key-value-pair-storage/internal/logging"
+	"github.com/Hierugu/go-key-value-pair-storage/txlog"
+)
+
+func newTestNode(t *testing.T, policy Policy) (*Node, *[]txlog.Event) {
+	t.Helper()
+	applied := &[]txlog.Event{}
+	n := NewNode("local", policy, func(e txlog.Event) {
+		*applied = append(*applied, e)
+	}, func(uint64) []txlog.Event { return nil }, logging.New("test"))
+	return n, applied
+}
+
+func TestReceiveAppliesNewerWriteAndDropsOlder(t *testing.T) {
+	n, applied := newTestNode(t, LastWriterWins)
+
+	n.receive(Frame{NodeID: "a", Event: txlog.Event{Sequence: 1, Key: "k", Value: "first", Lamport: 5}})
+	n.receive(Frame{NodeID: "b", Event: txlog.Event{Sequence: 1, Key: "k", Value: "stale", Lamport: 3}})
+
+	if len(*applied) != 1 || (*applied)[0].Value != "first" {
+		t.Fatalf("expected only the higher-Lamport write to be applied, got %+v", *applied)
+	}
+}
+
+func TestReceiveLastWriterWinsTieBreaksOnNodeID(t *testing.T) {
+	n, applied := newTestNode(t, LastWriterWins)
+
+	n.receive(Frame{NodeID: "b", Event: txlog.Event{Sequence: 1, Key: "k", Value: "from-b", Lamport: 5}})
+	n.receive(Frame{NodeID: "a", Event: txlog.Event{Sequence: 1, Key: "k", Value: "from-a", Lamport: 5}})
+
+	if len(*applied) != 1 || (*applied)[0].Value != "from-b" {
+		t.Fatalf("expected the tie to be broken towards the larger node id, got %+v", *applied)
+	}
+}
+
+func TestReceiveRejectOnConflictDropsBothSides(t *testing.T) {
+	n, applied := newTestNode(t, RejectOnConflict)
+
+	n.receive(Frame{NodeID: "a", Event: txlog.Event{Sequence: 1, Key: "k", Value: "first", Lamport: 5}})
+	n.receive(Frame{NodeID: "b", Event: txlog.Event{Sequence: 1, Key: "k", Value: "conflicting", Lamport: 3}})
+
+	if len(*applied) != 1 || (*applied)[0].Value != "first" {
+		t.Fatalf("expected the conflicting write to be rejected rather than applied, got %+v", *applied)
+	}
+}
+
+func TestReceiveDropsDuplicateAndOutOfOrderDelivery(t *testing.T) {
+	n, applied := newTestNode(t, LastWriterWins)
+
+	n.receive(Frame{NodeID: "a", Event: txlog.Event{Sequence: 5, Key: "k", Value: "v5", Lamport: 1}})
+	n.receive(Frame{NodeID: "a", Event: txlog.Event{Sequence: 5, Key: "k", Value: "v5-dup", Lamport: 1}})
+	n.receive(Frame{NodeID: "a", Event: txlog.Event{Sequence: 3, Key: "k", Value: "v3-late", Lamport: 0}})
+
+	if len(*applied) != 1 || (*applied)[0].Value != "v5" {
+		t.Fatalf("expected duplicate and out-of-order frames to be dropped, got %+v", *applied)
+	}
+}
+
+func TestReceiveAdvancesLamportClockFromPeers(t *testing.T) {
+	n, _ := newTestNode(t, LastWriterWins)
+
+	n.receive(Frame{NodeID: "a", Event: txlog.Event{Sequence: 1, Key: "k", Value: "v", Lamport: 100}})
+
+	n.mu.Lock()
+	lamport := n.lamport
+	n.mu.Unlock()
+
+	if lamport <= 100 {
+		t.Fatalf("expected local Lamport clock to advance past a higher incoming value, got %d", lamport)
+	}
+}
@@ -0,0 +1,162 @@
+package cluster
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/Hierugu/go-key-value-pair-storage/internal/logging"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+const (
+	peerOutboxSize = 64
+	peerPingPeriod = 30 * time.Second
+	peerPongWait   = 60 * time.Second
+)
+
+// peer is one live replication connection, inbound or outbound.
+type peer struct {
+	url  string // empty for a peer that connected to us
+	conn *websocket.Conn
+	out  chan Frame
+}
+
+func (n *Node) addPeer(p *peer) {
+	n.mu.Lock()
+	n.peers[p] = struct{}{}
+	n.mu.Unlock()
+}
+
+func (n *Node) removePeer(p *peer) {
+	n.mu.Lock()
+	delete(n.peers, p)
+	n.mu.Unlock()
+}
+
+func (n *Node) vectorSnapshot() map[string]uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	v := make(map[string]uint64, len(n.vector))
+	for k, val := range n.vector {
+		v[k] = val
+	}
+	return v
+}
+
+// ServeReplicate upgrades an inbound /v1/replicate request to a websocket
+// and runs the replication session until the connection drops.
+func (n *Node) ServeReplicate(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		n.logger.Error("replicate upgrade failed", logging.F("err", err))
+		return
+	}
+	n.runPeer(&peer{conn: conn, out: make(chan Frame, peerOutboxSize)})
+}
+
+// ConnectPeers dials every peer URL in urls and maintains a reconnecting
+// replication session with each one for the lifetime of the process.
+func (n *Node) ConnectPeers(urls []string) {
+	for _, u := range urls {
+		go n.maintainPeer(u)
+	}
+}
+
+func (n *Node) maintainPeer(url string) {
+	backoff := time.Second
+	for {
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			n.logger.Warn("peer dial failed, retrying", logging.F("peer", url), logging.F("err", err))
+			time.Sleep(backoff)
+			if backoff < 30*time.Second {
+				backoff *= 2
+			}
+			continue
+		}
+		backoff = time.Second
+		n.runPeer(&peer{url: url, conn: conn, out: make(chan Frame, peerOutboxSize)})
+	}
+}
+
+// runPeer exchanges hello messages to discover what each side is missing,
+// replays anything the other side needs, then gossips frames both ways
+// until the connection closes.
+func (n *Node) runPeer(p *peer) {
+	defer p.conn.Close()
+
+	ownHello := hello{NodeID: n.nodeID, Vector: n.vectorSnapshot()}
+	if err := p.conn.WriteJSON(ownHello); err != nil {
+		n.logger.Warn("peer hello write failed", logging.F("peer", p.url), logging.F("err", err))
+		return
+	}
+
+	var theirHello hello
+	if err := p.conn.ReadJSON(&theirHello); err != nil {
+		n.logger.Warn("peer hello read failed", logging.F("peer", p.url), logging.F("err", err))
+		return
+	}
+
+	n.addPeer(p)
+	defer n.removePeer(p)
+
+	closed := make(chan struct{})
+	p.conn.SetReadDeadline(time.Now().Add(peerPongWait))
+	p.conn.SetPongHandler(func(string) error {
+		p.conn.SetReadDeadline(time.Now().Add(peerPongWait))
+		return nil
+	})
+
+	// Feed replay into the same channel the write loop below drains,
+	// on its own goroutine: p.out only holds peerOutboxSize frames, and a
+	// reconnecting peer can easily be missing more than that, which would
+	// otherwise block this goroutine before the write loop even starts.
+	// It selects on closed too, so it can't leak past the connection
+	// dropping.
+	replay := n.replay(theirHello.Vector[n.nodeID])
+	go func() {
+		for _, e := range replay {
+			select {
+			case p.out <- Frame{NodeID: n.nodeID, Event: e}:
+			case <-closed:
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer close(closed)
+		for {
+			var f Frame
+			if err := p.conn.ReadJSON(&f); err != nil {
+				return
+			}
+			n.receive(f)
+		}
+	}()
+
+	ticker := time.NewTicker(peerPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case f := <-p.out:
+			if err := p.conn.WriteJSON(f); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := p.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	eventsPongWait   = 60 * time.Second
+	eventsPingPeriod = 30 * time.Second
+)
+
+var eventsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// eventsHandler upgrades to a websocket and streams every Put/Delete as a
+// JSON frame, optionally filtered by ?prefix= and preceded by a snapshot
+// burst when ?snapshot=1 is set.
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+
+	conn, err := eventsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(eventsPongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(eventsPongWait))
+		return nil
+	})
+
+	// Reads are only needed to drive the pong handler and notice the
+	// client going away; discard anything the client actually sends.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ch := eventHub.subscribe(prefix)
+	defer eventHub.unsubscribe(ch)
+
+	if r.URL.Query().Get("snapshot") == "1" {
+		for _, ki := range sortedKeys(prefix) {
+			value, err := Get(ki.Key)
+			if err != nil {
+				continue
+			}
+			if err := conn.WriteJSON(wsEvent{Seq: ki.Sequence, Type: "put", Key: ki.Key, Value: value}); err != nil {
+				return
+			}
+		}
+	}
+
+	ticker := time.NewTicker(eventsPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := conn.WriteJSON(e); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"sync"
+)
+
+// wsEvent is the JSON frame pushed to subscribers of /v1/events.
+type wsEvent struct {
+	Seq   uint64 `json:"seq"`
+	Type  string `json:"type"`
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+// subscriberBuffer is how many unread events a subscriber may queue before
+// it is considered a slow consumer and new events are dropped for it rather
+// than blocking Put/Delete.
+const subscriberBuffer = 16
+
+// hub is a small mutex-protected pub/sub broker: Put and Delete publish to
+// it after mutating the store, and every /v1/events connection owns one
+// subscriber channel filtered by an optional key prefix.
+type hub struct {
+	mu   sync.Mutex
+	subs map[chan wsEvent]string
+}
+
+var eventHub = &hub{subs: make(map[chan wsEvent]string)}
+
+func (h *hub) subscribe(prefix string) chan wsEvent {
+	ch := make(chan wsEvent, subscriberBuffer)
+	h.mu.Lock()
+	h.subs[ch] = prefix
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *hub) unsubscribe(ch chan wsEvent) {
+	h.mu.Lock()
+	delete(h.subs, ch)
+	h.mu.Unlock()
+	close(ch)
+}
+
+func (h *hub) publish(e wsEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch, prefix := range h.subs {
+		if prefix != "" && !strings.HasPrefix(e.Key, prefix) {
+			continue
+		}
+		select {
+		case ch <- e:
+		default:
+			// Slow consumer: drop the event rather than block Put/Delete.
+		}
+	}
+}
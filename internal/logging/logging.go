@@ -0,0 +1,177 @@
+// Package logging is a small contextual logger: a Logger carries a name and
+// a preset list of key/value fields, and every record it emits carries that
+// context along with whatever fields are passed to the call site. Deriving
+// a child logger with With adds fields without touching the parent.
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	LevelTrace Level = iota
+	LevelDebug
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelTrace:
+		return "trace"
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseLevel accepts the level names the -log-level flag understands.
+func ParseLevel(s string) (Level, error) {
+	switch s {
+	case "trace":
+		return LevelTrace, nil
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+}
+
+type Format int
+
+const (
+	FormatText Format = iota
+	FormatJSON
+)
+
+// ParseFormat accepts the formatter names the -log-format flag understands.
+func ParseFormat(s string) (Format, error) {
+	switch s {
+	case "text":
+		return FormatText, nil
+	case "json":
+		return FormatJSON, nil
+	default:
+		return 0, fmt.Errorf("unknown log format %q", s)
+	}
+}
+
+// Field is one key/value pair attached to a logger or a single record.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Logger carries a name and preset fields; every derived or standalone
+// logger shares the same output and settings via shared, via the
+// *settings pointer.
+type Logger struct {
+	name   string
+	fields []Field
+	s      *settings
+}
+
+// settings is shared by a Logger and every Logger derived from it with
+// With, so that SetLevel/SetFormat/SetOutput on the root affects the whole
+// family.
+type settings struct {
+	mu     sync.Mutex
+	level  Level
+	format Format
+	out    io.Writer
+}
+
+// New creates a root logger named name with an optional set of preset
+// fields. It defaults to info level, text format, stderr.
+func New(name string, fields ...Field) *Logger {
+	return &Logger{
+		name:   name,
+		fields: fields,
+		s:      &settings{level: LevelInfo, format: FormatText, out: os.Stderr},
+	}
+}
+
+// With derives a child logger that adds fields on top of l's own.
+func (l *Logger) With(fields ...Field) *Logger {
+	return &Logger{
+		name:   l.name,
+		fields: append(append([]Field{}, l.fields...), fields...),
+		s:      l.s,
+	}
+}
+
+func (l *Logger) SetLevel(level Level)    { l.s.mu.Lock(); l.s.level = level; l.s.mu.Unlock() }
+func (l *Logger) SetFormat(format Format) { l.s.mu.Lock(); l.s.format = format; l.s.mu.Unlock() }
+func (l *Logger) SetOutput(w io.Writer)   { l.s.mu.Lock(); l.s.out = w; l.s.mu.Unlock() }
+
+func (l *Logger) Trace(msg string, fields ...Field) { l.log(LevelTrace, msg, fields) }
+func (l *Logger) Debug(msg string, fields ...Field) { l.log(LevelDebug, msg, fields) }
+func (l *Logger) Info(msg string, fields ...Field)  { l.log(LevelInfo, msg, fields) }
+func (l *Logger) Warn(msg string, fields ...Field)  { l.log(LevelWarn, msg, fields) }
+func (l *Logger) Error(msg string, fields ...Field) { l.log(LevelError, msg, fields) }
+
+func (l *Logger) log(level Level, msg string, fields []Field) {
+	l.s.mu.Lock()
+	defer l.s.mu.Unlock()
+
+	if level < l.s.level {
+		return
+	}
+
+	all := append(append([]Field{}, l.fields...), fields...)
+	switch l.s.format {
+	case FormatJSON:
+		l.writeJSON(level, msg, all)
+	default:
+		l.writeText(level, msg, all)
+	}
+}
+
+func (l *Logger) writeText(level Level, msg string, fields []Field) {
+	fmt.Fprintf(l.s.out, "%s level=%s logger=%s msg=%q", time.Now().Format(time.RFC3339), level, l.name, msg)
+	for _, f := range fields {
+		fmt.Fprintf(l.s.out, " %s=%v", f.Key, f.Value)
+	}
+	fmt.Fprintln(l.s.out)
+}
+
+func (l *Logger) writeJSON(level Level, msg string, fields []Field) {
+	record := make(map[string]interface{}, len(fields)+4)
+	record["time"] = time.Now().Format(time.RFC3339)
+	record["level"] = level.String()
+	record["logger"] = l.name
+	record["msg"] = msg
+	for _, f := range fields {
+		record[f.Key] = f.Value
+	}
+
+	enc := json.NewEncoder(l.s.out)
+	if err := enc.Encode(record); err != nil {
+		fmt.Fprintf(os.Stderr, "logging: failed to encode record: %v\n", err)
+	}
+}
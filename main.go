@@ -1,50 +1,357 @@
 package main
 
 import (
-	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
+
+	"github.com/Hierugu/go-key-value-pair-storage/cluster"
+	"github.com/Hierugu/go-key-value-pair-storage/internal/logging"
+	"github.com/Hierugu/go-key-value-pair-storage/txlog"
 )
 
+var transact txlog.TransactionLogger
+
+// clusterNode is this process's membership in the replication cluster; it's
+// always non-nil by the time requests are served, even when -peers is empty.
+var clusterNode *cluster.Node
+
+// trashTTL is how long a trashed key is kept before the purge sweep removes
+// it for good; set from -trash-ttl in main.
+var trashTTL = 24 * time.Hour
+
+// entry is what the store keeps per key: the value plus enough metadata to
+// answer the index endpoint without re-deriving it on every request.
+type entry struct {
+	value    string
+	sequence uint64
+}
+
+// trashEntry is what a trashed key keeps around until it's purged or
+// restored.
+type trashEntry struct {
+	value     string
+	trashedAt time.Time
+	sequence  uint64
+}
+
 var myMap = struct {
 	sync.RWMutex
-	m map[string]string
-}{m: make(map[string]string)}
+	m            map[string]entry
+	trash        map[string]trashEntry
+	lastSequence uint64
+}{m: make(map[string]entry), trash: make(map[string]trashEntry)}
 
 var ErrorNoSuchKey = errors.New("No such key")
 
-func Put(key, value string) error {
+// putInternal applies a Put to the local store, the transaction log and the
+// event hub, and returns the sequence number it was assigned. It's shared by
+// Put (for locally originated writes) and applyRemoteEvent (for writes
+// gossiped in from a peer).
+func putInternal(key, value string) uint64 {
 	myMap.Lock()
-	myMap.m[key] = value
+	myMap.lastSequence++
+	seq := myMap.lastSequence
+	myMap.m[key] = entry{value: value, sequence: seq}
+	delete(myMap.trash, key)
+	transact.WritePut(seq, key, value)
 	myMap.Unlock()
+
+	eventHub.publish(wsEvent{Seq: seq, Type: "put", Key: key, Value: value})
+	return seq
+}
+
+func Put(key, value string) error {
+	seq := putInternal(key, value)
+
+	e := txlog.Event{Sequence: seq, EventType: txlog.EventPut, Key: key, Value: value}
+	clusterNode.Broadcast(e)
 	return nil
 }
 
 func Get(key string) (string, error) {
 	myMap.RLock()
-	value, ok := myMap.m[key]
+	e, ok := myMap.m[key]
 	myMap.RUnlock()
 
 	if !ok {
 		return "", ErrorNoSuchKey
 	}
-	return value, nil
+	return e.value, nil
 }
 
-func Delete(key string) error {
+// Delete moves key into the trash rather than removing it immediately; it
+// is purged for good once it has sat there longer than trashTTL, unless
+// Untrash restores it first. Deleting a key that doesn't exist is a no-op,
+// same as before trash existed.
+// trashInternal moves key into the trash, the same way Delete always has.
+// ok is false if key wasn't live, in which case it's a no-op.
+func trashInternal(key string) (value string, trashedAt time.Time, seq uint64, ok bool) {
 	myMap.Lock()
+	e, exists := myMap.m[key]
+	if !exists {
+		myMap.Unlock()
+		return "", time.Time{}, 0, false
+	}
+	myMap.lastSequence++
+	seq = myMap.lastSequence
+	trashedAt = time.Now()
 	delete(myMap.m, key)
+	myMap.trash[key] = trashEntry{value: e.value, trashedAt: trashedAt, sequence: seq}
+	transact.WriteTrash(seq, key, e.value, trashedAt.Unix())
+	myMap.Unlock()
+
+	eventHub.publish(wsEvent{Seq: seq, Type: "trash", Key: key})
+	return e.value, trashedAt, seq, true
+}
+
+func Delete(key string) error {
+	value, trashedAt, seq, ok := trashInternal(key)
+	if !ok {
+		return nil
+	}
+
+	e := txlog.Event{Sequence: seq, EventType: txlog.EventTrash, Key: key, Value: value, Timestamp: trashedAt.Unix()}
+	clusterNode.Broadcast(e)
+	return nil
+}
+
+// untrashInternal restores a trashed key to the live map. It returns
+// ErrorNoSuchKey if key isn't currently trashed.
+func untrashInternal(key string) (value string, seq uint64, err error) {
+	myMap.Lock()
+	te, ok := myMap.trash[key]
+	if !ok {
+		myMap.Unlock()
+		return "", 0, ErrorNoSuchKey
+	}
+	myMap.lastSequence++
+	seq = myMap.lastSequence
+	delete(myMap.trash, key)
+	myMap.m[key] = entry{value: te.value, sequence: seq}
+	transact.WriteUntrash(seq, key, te.value)
 	myMap.Unlock()
+
+	eventHub.publish(wsEvent{Seq: seq, Type: "untrash", Key: key, Value: te.value})
+	return te.value, seq, nil
+}
+
+// Untrash restores a trashed key to the live map. It returns
+// ErrorNoSuchKey if key isn't currently trashed.
+func Untrash(key string) error {
+	value, seq, err := untrashInternal(key)
+	if err != nil {
+		return err
+	}
+
+	e := txlog.Event{Sequence: seq, EventType: txlog.EventUntrash, Key: key, Value: value}
+	clusterNode.Broadcast(e)
 	return nil
 }
 
+// trashInfo is the per-entry metadata returned by the trash listing
+// endpoint.
+type trashInfo struct {
+	Key       string    `json:"key"`
+	Size      int       `json:"size"`
+	TrashedAt time.Time `json:"trashed_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+// listTrash returns, under a brief RLock, every trashed key with its
+// scheduled purge time.
+func listTrash() []trashInfo {
+	myMap.RLock()
+	items := make([]trashInfo, 0, len(myMap.trash))
+	for k, te := range myMap.trash {
+		items = append(items, trashInfo{Key: k, Size: len(te.value), TrashedAt: te.trashedAt, PurgeAt: te.trashedAt.Add(trashTTL)})
+	}
+	myMap.RUnlock()
+
+	sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+	return items
+}
+
+// purgeInternal drops every trashed key that has been sitting longer than
+// ttl, permanently and irrecoverably, and returns the delete event recorded
+// for each one.
+func purgeInternal(ttl time.Duration) []txlog.Event {
+	now := time.Now()
+
+	myMap.Lock()
+	var expired []string
+	for k, te := range myMap.trash {
+		if now.Sub(te.trashedAt) >= ttl {
+			expired = append(expired, k)
+		}
+	}
+	events := make([]txlog.Event, 0, len(expired))
+	for _, k := range expired {
+		delete(myMap.trash, k)
+		myMap.lastSequence++
+		seq := myMap.lastSequence
+		transact.WriteDelete(seq, k)
+		events = append(events, txlog.Event{Sequence: seq, EventType: txlog.EventDelete, Key: k})
+	}
+	myMap.Unlock()
+
+	for _, e := range events {
+		eventHub.publish(wsEvent{Seq: e.Sequence, Type: "delete", Key: e.Key})
+	}
+	return events
+}
+
+// purgeExpiredTrash drops every trashed key that has been sitting longer
+// than ttl, then gossips each deletion to the rest of the cluster.
+func purgeExpiredTrash(ttl time.Duration) {
+	for _, e := range purgeInternal(ttl) {
+		clusterNode.Broadcast(e)
+	}
+}
+
+// trashSweepInterval is how often purgeExpiredTrash runs; trashTTL just
+// needs to be checked often enough relative to its own value, so a fixed
+// interval well under the default TTL is fine.
+const trashSweepInterval = time.Minute
+
+// runTrashPurger runs purgeExpiredTrash on a ticker until the process
+// exits.
+func runTrashPurger(ttl time.Duration) {
+	ticker := time.NewTicker(trashSweepInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		purgeExpiredTrash(ttl)
+	}
+}
+
+// replayEventsAfter implements cluster.ReplayFunc: it replays this node's
+// own transaction log and returns every event with Sequence > afterSeq, so
+// a peer that reconnects behind gets a complete resync straight from
+// durable storage rather than a bounded in-memory window that a restart,
+// or a long enough disconnect, would have already emptied.
+func replayEventsAfter(afterSeq uint64) []txlog.Event {
+	events, errs := transact.ReadEvents()
+
+	var out []txlog.Event
+	for e := range events {
+		if e.Sequence > afterSeq {
+			out = append(out, e)
+		}
+	}
+	if err := <-errs; err != nil {
+		log.Print(err)
+	}
+	return out
+}
+
+// applyRemoteEvent implements cluster.ApplyFunc: it applies a mutation
+// gossiped in from a peer, once cluster.Node has already resolved any
+// conflict and deduplicated it against the vector clock. It never
+// broadcasts: re-gossiping what a peer just told us is that peer's job,
+// not ours.
+func applyRemoteEvent(e txlog.Event) {
+	switch e.EventType {
+	case txlog.EventPut:
+		putInternal(e.Key, e.Value)
+	case txlog.EventTrash:
+		myMap.Lock()
+		delete(myMap.m, e.Key)
+		myMap.lastSequence++
+		seq := myMap.lastSequence
+		trashedAt := time.Unix(e.Timestamp, 0)
+		myMap.trash[e.Key] = trashEntry{value: e.Value, trashedAt: trashedAt, sequence: seq}
+		transact.WriteTrash(seq, e.Key, e.Value, e.Timestamp)
+		myMap.Unlock()
+
+		eventHub.publish(wsEvent{Seq: seq, Type: "trash", Key: e.Key})
+	case txlog.EventUntrash:
+		myMap.Lock()
+		delete(myMap.trash, e.Key)
+		myMap.lastSequence++
+		seq := myMap.lastSequence
+		myMap.m[e.Key] = entry{value: e.Value, sequence: seq}
+		transact.WriteUntrash(seq, e.Key, e.Value)
+		myMap.Unlock()
+
+		eventHub.publish(wsEvent{Seq: seq, Type: "untrash", Key: e.Key, Value: e.Value})
+	case txlog.EventDelete:
+		myMap.Lock()
+		delete(myMap.m, e.Key)
+		delete(myMap.trash, e.Key)
+		myMap.lastSequence++
+		seq := myMap.lastSequence
+		transact.WriteDelete(seq, e.Key)
+		myMap.Unlock()
+
+		eventHub.publish(wsEvent{Seq: seq, Type: "delete", Key: e.Key})
+	}
+}
+
+// generateNodeID picks this node's cluster identity when -node-id isn't set.
+func generateNodeID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		log.Fatal(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// snapshotState returns, under a brief RLock, the current key/value state
+// (each key with its own last-modified sequence) and the sequence number
+// the snapshot was taken at, for handing to a Compactor.
+func snapshotState() (map[string]txlog.CompactEntry, map[string]txlog.TrashCompactEntry, uint64) {
+	myMap.RLock()
+	defer myMap.RUnlock()
+
+	state := make(map[string]txlog.CompactEntry, len(myMap.m))
+	for k, e := range myMap.m {
+		state[k] = txlog.CompactEntry{Value: e.value, Sequence: e.sequence}
+	}
+	trash := make(map[string]txlog.TrashCompactEntry, len(myMap.trash))
+	for k, te := range myMap.trash {
+		trash[k] = txlog.TrashCompactEntry{Value: te.value, TrashedAt: te.trashedAt.Unix(), Sequence: te.sequence}
+	}
+	return state, trash, myMap.lastSequence
+}
+
+// keyInfo is the per-entry metadata returned by the index endpoint.
+type keyInfo struct {
+	Key      string `json:"key"`
+	Size     int    `json:"size"`
+	Sequence uint64 `json:"sequence"`
+}
+
+// sortedKeys returns, under a brief RLock, a snapshot of every key whose name
+// begins with prefix, sorted lexicographically. The lock is released before
+// the caller does anything with the result, so it never stays held across a
+// response write.
+func sortedKeys(prefix string) []keyInfo {
+	myMap.RLock()
+	snapshot := make([]keyInfo, 0, len(myMap.m))
+	for k, e := range myMap.m {
+		if strings.HasPrefix(k, prefix) {
+			snapshot = append(snapshot, keyInfo{Key: k, Size: len(e.value), Sequence: e.sequence})
+		}
+	}
+	myMap.RUnlock()
+
+	sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].Key < snapshot[j].Key })
+	return snapshot
+}
+
 // Удоавлетворяет типу HandlerFunc
 func helloMuxHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("Hello gorilla/mux!\n"))
@@ -52,33 +359,41 @@ func helloMuxHandler(w http.ResponseWriter, r *http.Request) {
 
 func keyValuePutHandler(w http.ResponseWriter, r *http.Request) {
 	key := mux.Vars(r)["key"]
+	logger := loggerFromRequest(r).With(logging.F("key", key))
+
 	value, err := io.ReadAll(r.Body)
 	defer r.Body.Close()
 
 	if err != nil {
+		logger.Error("failed to read body", logging.F("err", err))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	err = Put(key, string(value))
 	if err != nil {
+		logger.Error("put failed", logging.F("err", err))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	logger.Info("put", logging.F("size", len(value)))
 	w.WriteHeader(http.StatusCreated)
 }
 
 func keyValueGetHandler(w http.ResponseWriter, r *http.Request) {
 	key := mux.Vars(r)["key"]
+	logger := loggerFromRequest(r).With(logging.F("key", key))
 	val, err := Get(key)
 
 	if errors.Is(err, ErrorNoSuchKey) {
+		logger.Debug("not found")
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
 	if err != nil {
+		logger.Error("get failed", logging.F("err", err))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -88,110 +403,231 @@ func keyValueGetHandler(w http.ResponseWriter, r *http.Request) {
 func keyValueDeleteHandler(w http.ResponseWriter, r *http.Request) {
 	key := mux.Vars(r)["key"]
 	Delete(key)
+	loggerFromRequest(r).With(logging.F("key", key)).Info("trash")
 	w.WriteHeader(http.StatusOK)
 }
 
-// Transaction Log
-type EventType byte
+func untrashHandler(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+	logger := loggerFromRequest(r).With(logging.F("key", key))
 
-const (
-	EventDelete EventType = 1
-	EventPut    EventType = 2
-)
+	err := Untrash(key)
+	if errors.Is(err, ErrorNoSuchKey) {
+		logger.Debug("not trashed")
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Error("untrash failed", logging.F("err", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-type TransactionLogger interface {
-	WriteDelete(key string)
-	WritePut(key, value string)
+	logger.Info("untrash")
+	w.WriteHeader(http.StatusOK)
 }
 
-type Event struct {
-	Sequence  uint64
-	EventType EventType
-	Key       string
-	Value     string
+// trashHandler lists every trashed key with its scheduled purge time.
+func trashHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(listTrash())
 }
 
-type FileTransactionLogger struct {
-	events       chan<- Event // Только запись
-	errors       <-chan error
-	lastSequence uint64
-	file         *os.File
-}
+// keysIndexHandler lists keys matching an optional prefix, one JSON object
+// per line, ordered by key name. The listing is paginated with ?limit= and
+// ?cursor=: cursor is the last key returned on the previous page, so the
+// next page starts just after it.
+func keysIndexHandler(w http.ResponseWriter, r *http.Request) {
+	prefix := mux.Vars(r)["prefix"]
+
+	limit := 0
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	cursor := r.URL.Query().Get("cursor")
 
-func (l *FileTransactionLogger) WritePut(key, value string) {
-	l.events <- Event{EventType: EventPut, Key: key, Value: value}
-}
+	keys := sortedKeys(prefix)
 
-func (l *FileTransactionLogger) WriteDelete(key string) {
-	l.events <- Event{EventType: EventDelete, Key: key}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	sent := 0
+	for _, ki := range keys {
+		if cursor != "" && ki.Key <= cursor {
+			continue
+		}
+		if limit > 0 && sent >= limit {
+			break
+		}
+		if err := enc.Encode(ki); err != nil {
+			return
+		}
+		sent++
+	}
 }
 
-func (l *FileTransactionLogger) Err() <-chan error {
-	return l.errors
-}
+// adminCompactHandler folds the live key/value state into the transaction
+// log's snapshot and drops the events that produced it. Only backends that
+// implement txlog.Compactor support this; others report 501.
+func adminCompactHandler(w http.ResponseWriter, r *http.Request) {
+	compactor, ok := transact.(txlog.Compactor)
+	if !ok {
+		http.Error(w, "current log backend does not support compaction", http.StatusNotImplemented)
+		return
+	}
 
-func NewFileTransactionLogger(filename string) (TransactionLogger, error) {
-	file, err := os.OpenFile(filename, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0755)
-	if err != nil {
-		return nil, fmt.Errorf("cannot open transaction log file: %w", err)
+	state, trash, asOf := snapshotState()
+	if err := compactor.Compact(state, trash, asOf); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
-	return &FileTransactionLogger{file: file}, nil
+	w.WriteHeader(http.StatusOK)
 }
 
-func (l *FileTransactionLogger) Run() {
-	events := make(chan Event, 16)
-	l.events = events
-	errors := make(chan error, 1)
-	l.errors = errors
+// clusterStatusHandler reports this node's cluster id, conflict policy,
+// connected peers and vector clock.
+func clusterStatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clusterNode.Status())
+}
 
-	go func() {
-		for e := range events {
-			l.lastSequence++
-			_, err := fmt.Fprintf(l.file, "%d\t%d\t%s\t%s\n", l.lastSequence, e.EventType, e.Key, e.Value)
+// newTransactionLogger builds the TransactionLogger selected by -log-backend.
+func newTransactionLogger(backend, path string) (txlog.TransactionLogger, error) {
+	switch backend {
+	case "file":
+		return txlog.NewFileTransactionLogger(path)
+	case "bolt":
+		return txlog.NewBoltTransactionLogger(path)
+	default:
+		return nil, fmt.Errorf("unknown -log-backend %q (want file or bolt)", backend)
+	}
+}
 
-			if err != nil {
-				errors <- err
-				return
+// replayTransactionLog rebuilds myMap from everything the logger already
+// has on disk, before the server starts accepting requests.
+func replayTransactionLog() error {
+	events, errs := transact.ReadEvents()
+	ok := true
+	var e txlog.Event
+	for ok {
+		select {
+		case err, open := <-errs:
+			if open {
+				return err
+			}
+			ok = false
+		case e, ok = <-events:
+			if !ok {
+				break
+			}
+			switch e.EventType {
+			case txlog.EventPut:
+				myMap.Lock()
+				delete(myMap.trash, e.Key)
+				myMap.m[e.Key] = entry{value: e.Value, sequence: e.Sequence}
+				myMap.Unlock()
+			case txlog.EventDelete:
+				myMap.Lock()
+				delete(myMap.m, e.Key)
+				delete(myMap.trash, e.Key)
+				myMap.Unlock()
+			case txlog.EventTrash:
+				myMap.Lock()
+				delete(myMap.m, e.Key)
+				myMap.trash[e.Key] = trashEntry{value: e.Value, trashedAt: time.Unix(e.Timestamp, 0), sequence: e.Sequence}
+				myMap.Unlock()
+			case txlog.EventUntrash:
+				myMap.Lock()
+				delete(myMap.trash, e.Key)
+				myMap.m[e.Key] = entry{value: e.Value, sequence: e.Sequence}
+				myMap.Unlock()
+			}
+			if e.Sequence > myMap.lastSequence {
+				myMap.lastSequence = e.Sequence
 			}
 		}
-	}()
+	}
+	return nil
 }
 
-func (l *FileTransactionLogger) ReadEvents() (<-chan Event, <-chan error) {
-	scanner := bufio.NewScanner(l.file)
-	outEvent := make(chan Event)
-	outError := make(chan error, 1)
+func main() {
+	logBackend := flag.String("log-backend", "file", "transaction log backend: file or bolt")
+	logPath := flag.String("log-path", "transaction.log", "path to the transaction log file/database")
+	logFormat := flag.String("log-format", "text", "log output format: text or json")
+	logLevel := flag.String("log-level", "info", "log level: trace, debug, info, warn, error")
+	flag.DurationVar(&trashTTL, "trash-ttl", 24*time.Hour, "how long a trashed key is kept before being purged for good")
+	peers := flag.String("peers", "", "comma-separated list of peer replication URLs (e.g. ws://host:8080/v1/replicate)")
+	nodeID := flag.String("node-id", "", "this node's cluster id (a random id is generated if empty)")
+	conflictPolicy := flag.String("cluster-conflict-policy", "last-writer-wins", "how to resolve concurrent writes to the same key: last-writer-wins or reject-on-conflict")
+	flag.Parse()
+
+	format, err := logging.ParseFormat(*logFormat)
+	if err != nil {
+		log.Fatal(err)
+	}
+	level, err := logging.ParseLevel(*logLevel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	policy, err := cluster.ParsePolicy(*conflictPolicy)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	baseLogger := logging.New("kv")
+	baseLogger.SetFormat(format)
+	baseLogger.SetLevel(level)
+
+	httpLogger := baseLogger.With(logging.F("component", "http"))
+	txLogger := baseLogger.With(logging.F("component", "txlog"))
+	clusterLogger := baseLogger.With(logging.F("component", "cluster"))
+
+	transact, err = newTransactionLogger(*logBackend, *logPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if fl, ok := transact.(*txlog.FileTransactionLogger); ok {
+		fl.SetLogger(txLogger)
+	}
+
+	if err := replayTransactionLog(); err != nil {
+		log.Fatal(err)
+	}
+	transact.Run()
 
 	go func() {
-		var e Event
-		defer close(outEvent)
-		defer close(outError)
-		for scanner.Scan() {
-			line := scanner.Text()
-			if _, err := fmt.Sscanf(line, "%d\t%d\t%s\t%s", &e.Sequence, &e.EventType, &e.Key, &e.Value); err != nil {
-				outError <- fmt.Errorf("input parse error: %w", err)
-				return
-			}
-			if l.lastSequence >= e.Sequence {
-				outError <- fmt.Errorf("transaction numbers out of sequence")
-				return
-			}
-			l.lastSequence = e.Sequence
-			outEvent <- e
-		}
-		if err := scanner.Err(); err != nil {
-			outError <- fmt.Errorf("transaction log read failure: %w", err)
-			return
+		for err := range transact.Err() {
+			log.Print(err)
 		}
 	}()
-	return outEvent, outError
-}
+	go runTrashPurger(trashTTL)
+
+	id := *nodeID
+	if id == "" {
+		id = generateNodeID()
+	}
+	clusterNode = cluster.NewNode(id, policy, applyRemoteEvent, replayEventsAfter, clusterLogger)
+	if *peers != "" {
+		clusterNode.ConnectPeers(strings.Split(*peers, ","))
+	}
 
-func main() {
 	r := mux.NewRouter()
+	r.Use(loggingMiddleware(httpLogger))
 	r.HandleFunc("/", helloMuxHandler)
 	r.HandleFunc("/v1/key/{key}", keyValuePutHandler).Methods("PUT")
 	r.HandleFunc("/v1/key/{key}", keyValueGetHandler).Methods("GET")
 	r.HandleFunc("/v1/key/{key}", keyValueDeleteHandler).Methods("DELETE")
+	r.HandleFunc("/v1/untrash/{key}", untrashHandler).Methods("PUT")
+	r.HandleFunc("/v1/trash", trashHandler).Methods("GET")
+	r.HandleFunc("/v1/keys", keysIndexHandler).Methods("GET")
+	r.HandleFunc("/v1/keys/{prefix}", keysIndexHandler).Methods("GET")
+	r.HandleFunc("/v1/admin/compact", adminCompactHandler).Methods("POST")
+	r.HandleFunc("/v1/events", eventsHandler).Methods("GET")
+	r.HandleFunc("/v1/replicate", clusterNode.ServeReplicate).Methods("GET")
+	r.HandleFunc("/v1/cluster/status", clusterStatusHandler).Methods("GET")
 	log.Fatal(http.ListenAndServe(":8080", r))
 }
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/Hierugu/go-key-value-pair-storage/internal/logging"
+)
+
+type loggerContextKey struct{}
+
+var nextRequestID uint64
+
+// loggingMiddleware derives a request-scoped logger (method, path,
+// request-id) from base and attaches it to the request context, so every
+// handler can pull it out with loggerFromRequest.
+func loggingMiddleware(base *logging.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := atomic.AddUint64(&nextRequestID, 1)
+			reqLogger := base.With(
+				logging.F("method", r.Method),
+				logging.F("path", r.URL.Path),
+				logging.F("request_id", id),
+			)
+			ctx := context.WithValue(r.Context(), loggerContextKey{}, reqLogger)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// loggerFromRequest returns the request-scoped logger attached by
+// loggingMiddleware, or a bare fallback if none was attached.
+func loggerFromRequest(r *http.Request) *logging.Logger {
+	if l, ok := r.Context().Value(loggerContextKey{}).(*logging.Logger); ok {
+		return l
+	}
+	return logging.New("http")
+}
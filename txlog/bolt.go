@@ -0,0 +1,267 @@
+package txlog
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/v5"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	eventsBucket        = []byte("events")
+	snapshotBucket      = []byte("snapshot")
+	trashSnapshotBucket = []byte("trash_snapshot")
+	metaBucket          = []byte("meta")
+
+	snapshotSeqKey = []byte("snapshot_seq")
+)
+
+// snapshotEntry is what BoltTransactionLogger stores per key in
+// snapshotBucket.
+type snapshotEntry struct {
+	Value    string
+	Sequence uint64
+}
+
+// trashSnapshotEntry is what BoltTransactionLogger stores per key in
+// trashSnapshotBucket: a trashed key's value survives compaction the same
+// way a live key's does, so it isn't lost when the events that trashed it
+// are truncated.
+type trashSnapshotEntry struct {
+	Value     string
+	TrashedAt int64
+	Sequence  uint64
+}
+
+// BoltTransactionLogger is a TransactionLogger backed by a bbolt database.
+// Every event is appended to eventsBucket, keyed by its big-endian encoded
+// sequence number. Compact folds the live events into snapshotBucket so a
+// later ReadEvents only has to replay the snapshot plus whatever events
+// have arrived since the last compaction, rather than the log from the
+// beginning of time.
+type BoltTransactionLogger struct {
+	db     *bolt.DB
+	events chan Event
+	errors chan error
+}
+
+// NewBoltTransactionLogger opens (creating if necessary) the bbolt database
+// at path and prepares its buckets.
+func NewBoltTransactionLogger(path string) (*BoltTransactionLogger, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open bolt transaction log: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{eventsBucket, snapshotBucket, trashSnapshotBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot initialize bolt transaction log: %w", err)
+	}
+
+	return &BoltTransactionLogger{db: db}, nil
+}
+
+func (l *BoltTransactionLogger) WritePut(sequence uint64, key, value string) {
+	l.events <- Event{Sequence: sequence, EventType: EventPut, Key: key, Value: value}
+}
+
+func (l *BoltTransactionLogger) WriteDelete(sequence uint64, key string) {
+	l.events <- Event{Sequence: sequence, EventType: EventDelete, Key: key}
+}
+
+func (l *BoltTransactionLogger) WriteTrash(sequence uint64, key, value string, timestamp int64) {
+	l.events <- Event{Sequence: sequence, EventType: EventTrash, Key: key, Value: value, Timestamp: timestamp}
+}
+
+func (l *BoltTransactionLogger) WriteUntrash(sequence uint64, key, value string) {
+	l.events <- Event{Sequence: sequence, EventType: EventUntrash, Key: key, Value: value}
+}
+
+func (l *BoltTransactionLogger) Err() <-chan error {
+	return l.errors
+}
+
+func (l *BoltTransactionLogger) Run() {
+	events := make(chan Event, 16)
+	l.events = events
+	errors := make(chan error, 1)
+	l.errors = errors
+
+	go func() {
+		for e := range events {
+			err := l.db.Update(func(tx *bolt.Tx) error {
+				raw, err := msgpack.Marshal(e)
+				if err != nil {
+					return err
+				}
+				return tx.Bucket(eventsBucket).Put(sequenceKey(e.Sequence), raw)
+			})
+			if err != nil {
+				errors <- err
+				return
+			}
+		}
+	}()
+}
+
+// ReadEvents replays snapshotBucket (one synthetic EventPut per key) and
+// trashSnapshotBucket (one synthetic EventTrash per trashed key, O(live keys
+// plus trashed keys)) followed by any events bucket entries newer than the
+// snapshot, so a restart doesn't have to walk the full history of the log.
+func (l *BoltTransactionLogger) ReadEvents() (<-chan Event, <-chan error) {
+	outEvent := make(chan Event)
+	outError := make(chan error, 1)
+
+	go func() {
+		defer close(outEvent)
+		defer close(outError)
+
+		var asOf uint64
+		if err := l.db.View(func(tx *bolt.Tx) error {
+			if raw := tx.Bucket(metaBucket).Get(snapshotSeqKey); raw != nil {
+				asOf = binary.BigEndian.Uint64(raw)
+			}
+
+			c := tx.Bucket(snapshotBucket).Cursor()
+			for k, v := c.First(); k != nil; k, v = c.Next() {
+				var se snapshotEntry
+				if err := msgpack.Unmarshal(v, &se); err != nil {
+					return fmt.Errorf("snapshot decode error: %w", err)
+				}
+				outEvent <- Event{Sequence: se.Sequence, EventType: EventPut, Key: string(k), Value: se.Value}
+			}
+
+			tc := tx.Bucket(trashSnapshotBucket).Cursor()
+			for k, v := tc.First(); k != nil; k, v = tc.Next() {
+				var te trashSnapshotEntry
+				if err := msgpack.Unmarshal(v, &te); err != nil {
+					return fmt.Errorf("trash snapshot decode error: %w", err)
+				}
+				outEvent <- Event{Sequence: te.Sequence, EventType: EventTrash, Key: string(k), Value: te.Value, Timestamp: te.TrashedAt}
+			}
+			return nil
+		}); err != nil {
+			outError <- err
+			return
+		}
+
+		if err := l.db.View(func(tx *bolt.Tx) error {
+			c := tx.Bucket(eventsBucket).Cursor()
+			for k, v := c.Seek(sequenceKey(asOf + 1)); k != nil; k, v = c.Next() {
+				var e Event
+				if err := msgpack.Unmarshal(v, &e); err != nil {
+					return fmt.Errorf("event decode error: %w", err)
+				}
+				outEvent <- e
+			}
+			return nil
+		}); err != nil {
+			outError <- err
+			return
+		}
+	}()
+
+	return outEvent, outError
+}
+
+func (l *BoltTransactionLogger) Close() error {
+	if l.events != nil {
+		close(l.events)
+	}
+	return l.db.Close()
+}
+
+// Compactor is implemented by transaction loggers that can fold the live
+// key/value state into a snapshot and discard the events that produced it.
+type Compactor interface {
+	Compact(state map[string]CompactEntry, trash map[string]TrashCompactEntry, asOfSequence uint64) error
+}
+
+// CompactEntry is what a caller hands Compact for each live key: the
+// value plus the sequence number it was last written at, so compaction
+// doesn't have to collapse every key down to the same asOfSequence.
+type CompactEntry struct {
+	Value    string
+	Sequence uint64
+}
+
+// TrashCompactEntry is what a caller hands Compact for each trashed key, so
+// a key sitting in trash at compaction time survives it: without a
+// snapshot record of its own, truncating the event log would otherwise
+// delete the EventTrash that put it there with nothing left to replay it
+// from.
+type TrashCompactEntry struct {
+	Value     string
+	TrashedAt int64
+	Sequence  uint64
+}
+
+// Compact writes state and trash into fresh snapshot buckets and drops
+// every event up to and including asOfSequence, atomically, so a future
+// ReadEvents only has to replay the snapshots plus events newer than
+// asOfSequence.
+func (l *BoltTransactionLogger) Compact(state map[string]CompactEntry, trash map[string]TrashCompactEntry, asOfSequence uint64) error {
+	return l.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(snapshotBucket); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		snap, err := tx.CreateBucket(snapshotBucket)
+		if err != nil {
+			return err
+		}
+		for k, v := range state {
+			raw, err := msgpack.Marshal(snapshotEntry{Value: v.Value, Sequence: v.Sequence})
+			if err != nil {
+				return err
+			}
+			if err := snap.Put([]byte(k), raw); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.DeleteBucket(trashSnapshotBucket); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		trashSnap, err := tx.CreateBucket(trashSnapshotBucket)
+		if err != nil {
+			return err
+		}
+		for k, v := range trash {
+			raw, err := msgpack.Marshal(trashSnapshotEntry{Value: v.Value, TrashedAt: v.TrashedAt, Sequence: v.Sequence})
+			if err != nil {
+				return err
+			}
+			if err := trashSnap.Put([]byte(k), raw); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Bucket(metaBucket).Put(snapshotSeqKey, sequenceKey(asOfSequence)); err != nil {
+			return err
+		}
+
+		events := tx.Bucket(eventsBucket)
+		c := events.Cursor()
+		for k, _ := c.First(); k != nil && binary.BigEndian.Uint64(k) <= asOfSequence; k, _ = c.Next() {
+			if err := events.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func sequenceKey(seq uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, seq)
+	return buf
+}
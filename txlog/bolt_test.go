@@ -0,0 +1,121 @@
+package txlog
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+	bolt "go.etcd.io/bbolt"
+)
+
+func openTestLogger(t *testing.T) *BoltTransactionLogger {
+	t.Helper()
+	l, err := NewBoltTransactionLogger(filepath.Join(t.TempDir(), "txlog.db"))
+	if err != nil {
+		t.Fatalf("NewBoltTransactionLogger: %v", err)
+	}
+	t.Cleanup(func() { l.db.Close() })
+	return l
+}
+
+// writeRawEvent writes e straight to eventsBucket, bypassing the async
+// Run/WritePut path so the test doesn't have to synchronize with it.
+func writeRawEvent(t *testing.T, l *BoltTransactionLogger, e Event) {
+	t.Helper()
+	if err := l.db.Update(func(tx *bolt.Tx) error {
+		raw, err := msgpack.Marshal(e)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(eventsBucket).Put(sequenceKey(e.Sequence), raw)
+	}); err != nil {
+		t.Fatalf("writeRawEvent: %v", err)
+	}
+}
+
+func drainEvents(t *testing.T, l *BoltTransactionLogger) []Event {
+	t.Helper()
+	events, errs := l.ReadEvents()
+
+	var out []Event
+	for e := range events {
+		out = append(out, e)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("ReadEvents: %v", err)
+	}
+	return out
+}
+
+func TestBoltCompactReplacesEventsWithSnapshotAtEachKeysOwnSequence(t *testing.T) {
+	l := openTestLogger(t)
+
+	writeRawEvent(t, l, Event{Sequence: 1, EventType: EventPut, Key: "a", Value: "1"})
+	writeRawEvent(t, l, Event{Sequence: 2, EventType: EventPut, Key: "b", Value: "2"})
+	writeRawEvent(t, l, Event{Sequence: 3, EventType: EventPut, Key: "a", Value: "3"})
+
+	state := map[string]CompactEntry{
+		"a": {Value: "3", Sequence: 3},
+		"b": {Value: "2", Sequence: 2},
+	}
+	if err := l.Compact(state, nil, 3); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+
+	got := drainEvents(t, l)
+	bySeq := make(map[string]uint64, len(got))
+	for _, e := range got {
+		bySeq[e.Key] = e.Sequence
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("expected one synthesized event per live key, got %d: %+v", len(got), got)
+	}
+	if bySeq["a"] != 3 {
+		t.Errorf("expected key a to keep its own last-modified sequence 3, got %d", bySeq["a"])
+	}
+	if bySeq["b"] != 2 {
+		t.Errorf("expected key b to keep its own last-modified sequence 2, not asOfSequence, got %d", bySeq["b"])
+	}
+}
+
+func TestBoltReadEventsAfterCompactOnlyReplaysNewerEvents(t *testing.T) {
+	l := openTestLogger(t)
+
+	writeRawEvent(t, l, Event{Sequence: 1, EventType: EventPut, Key: "a", Value: "1"})
+
+	if err := l.Compact(map[string]CompactEntry{"a": {Value: "1", Sequence: 1}}, nil, 1); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+
+	writeRawEvent(t, l, Event{Sequence: 2, EventType: EventPut, Key: "b", Value: "2"})
+
+	got := drainEvents(t, l)
+	if len(got) != 2 {
+		t.Fatalf("expected the snapshot entry plus the one event since compaction, got %d: %+v", len(got), got)
+	}
+	if got[0].Key != "a" || got[1].Key != "b" {
+		t.Fatalf("expected snapshot entries before post-compaction events, got %+v", got)
+	}
+}
+
+func TestBoltCompactPreservesTrashedKeys(t *testing.T) {
+	l := openTestLogger(t)
+
+	writeRawEvent(t, l, Event{Sequence: 1, EventType: EventTrash, Key: "a", Value: "1", Timestamp: 1000})
+
+	trash := map[string]TrashCompactEntry{
+		"a": {Value: "1", TrashedAt: 1000, Sequence: 1},
+	}
+	if err := l.Compact(nil, trash, 1); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+
+	got := drainEvents(t, l)
+	if len(got) != 1 {
+		t.Fatalf("expected the trashed key to survive compaction as a synthesized event, got %d: %+v", len(got), got)
+	}
+	if got[0].EventType != EventTrash || got[0].Key != "a" || got[0].Value != "1" || got[0].Timestamp != 1000 {
+		t.Fatalf("expected a synthesized EventTrash for the compacted-in trash entry, got %+v", got[0])
+	}
+}
@@ -0,0 +1,154 @@
+package txlog
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Hierugu/go-key-value-pair-storage/internal/logging"
+)
+
+// FileTransactionLogger appends events to a plain tab-separated text file,
+// one event per line.
+type FileTransactionLogger struct {
+	events       chan Event // Только запись со стороны вызывающего кода
+	errors       chan error
+	lastSequence uint64
+	file         *os.File
+	logger       *logging.Logger
+}
+
+// NewFileTransactionLogger opens (creating if necessary) the log file at
+// filename.
+func NewFileTransactionLogger(filename string) (*FileTransactionLogger, error) {
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open transaction log file: %w", err)
+	}
+	return &FileTransactionLogger{file: file, logger: logging.New("txlog")}, nil
+}
+
+// SetLogger replaces the logger used by Run and ReadEvents, e.g. with one
+// carrying a component=txlog field.
+func (l *FileTransactionLogger) SetLogger(logger *logging.Logger) {
+	l.logger = logger
+}
+
+func (l *FileTransactionLogger) WritePut(sequence uint64, key, value string) {
+	l.events <- Event{Sequence: sequence, EventType: EventPut, Key: key, Value: value}
+}
+
+func (l *FileTransactionLogger) WriteDelete(sequence uint64, key string) {
+	l.events <- Event{Sequence: sequence, EventType: EventDelete, Key: key}
+}
+
+func (l *FileTransactionLogger) WriteTrash(sequence uint64, key, value string, timestamp int64) {
+	l.events <- Event{Sequence: sequence, EventType: EventTrash, Key: key, Value: value, Timestamp: timestamp}
+}
+
+func (l *FileTransactionLogger) WriteUntrash(sequence uint64, key, value string) {
+	l.events <- Event{Sequence: sequence, EventType: EventUntrash, Key: key, Value: value}
+}
+
+func (l *FileTransactionLogger) Err() <-chan error {
+	return l.errors
+}
+
+func (l *FileTransactionLogger) Run() {
+	events := make(chan Event, 16)
+	l.events = events
+	errors := make(chan error, 1)
+	l.errors = errors
+
+	go func() {
+		for e := range events {
+			var err error
+			if e.EventType == EventTrash {
+				_, err = fmt.Fprintf(l.file, "%d\t%d\t%s\t%s\t%d\n", e.Sequence, e.EventType, e.Key, e.Value, e.Timestamp)
+			} else {
+				_, err = fmt.Fprintf(l.file, "%d\t%d\t%s\t%s\n", e.Sequence, e.EventType, e.Key, e.Value)
+			}
+
+			if err != nil {
+				l.logger.Error("write failed", logging.F("sequence", e.Sequence), logging.F("key", e.Key), logging.F("err", err))
+				errors <- err
+				return
+			}
+			l.logger.Debug("wrote event", logging.F("sequence", e.Sequence), logging.F("key", e.Key), logging.F("event_type", e.EventType))
+		}
+	}()
+}
+
+func (l *FileTransactionLogger) ReadEvents() (<-chan Event, <-chan error) {
+	scanner := bufio.NewScanner(l.file)
+	outEvent := make(chan Event)
+	outError := make(chan error, 1)
+
+	go func() {
+		defer close(outEvent)
+		defer close(outError)
+		for scanner.Scan() {
+			line := scanner.Text()
+			e, err := parseEventLine(line)
+			if err != nil {
+				l.logger.Error("parse failed", logging.F("line", line), logging.F("err", err))
+				outError <- fmt.Errorf("input parse error: %w", err)
+				return
+			}
+			if l.lastSequence >= e.Sequence {
+				l.logger.Error("sequence out of order", logging.F("last_sequence", l.lastSequence), logging.F("sequence", e.Sequence))
+				outError <- ErrOutOfSequence
+				return
+			}
+			l.lastSequence = e.Sequence
+			l.logger.Debug("replayed event", logging.F("sequence", e.Sequence), logging.F("key", e.Key), logging.F("event_type", e.EventType))
+			outEvent <- e
+		}
+		if err := scanner.Err(); err != nil {
+			l.logger.Error("read failed", logging.F("err", err))
+			outError <- fmt.Errorf("transaction log read failure: %w", err)
+			return
+		}
+	}()
+	return outEvent, outError
+}
+
+func (l *FileTransactionLogger) Close() error {
+	if l.events != nil {
+		close(l.events)
+	}
+	return l.file.Close()
+}
+
+// parseEventLine parses one tab-separated log line. Every event type has
+// always been written as sequence/type/key/value; EventTrash lines carry a
+// fifth, trailing timestamp field. Splitting on tabs rather than relying on
+// a fixed Sscanf format lets old 4-field lines and new 5-field lines share a
+// parser.
+func parseEventLine(line string) (Event, error) {
+	parts := strings.SplitN(line, "\t", 5)
+	if len(parts) < 4 {
+		return Event{}, fmt.Errorf("malformed transaction log line: %q", line)
+	}
+
+	seq, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return Event{}, fmt.Errorf("malformed sequence: %w", err)
+	}
+	et, err := strconv.ParseUint(parts[1], 10, 8)
+	if err != nil {
+		return Event{}, fmt.Errorf("malformed event type: %w", err)
+	}
+
+	e := Event{Sequence: seq, EventType: EventType(et), Key: parts[2], Value: parts[3]}
+	if len(parts) == 5 {
+		ts, err := strconv.ParseInt(parts[4], 10, 64)
+		if err != nil {
+			return Event{}, fmt.Errorf("malformed timestamp: %w", err)
+		}
+		e.Timestamp = ts
+	}
+	return e, nil
+}
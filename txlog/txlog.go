@@ -0,0 +1,71 @@
+// Package txlog defines the transaction log abstraction used to make every
+// Put/Delete durable, plus the implementations that back it.
+package txlog
+
+import "errors"
+
+// ErrOutOfSequence is returned by ReadEvents when two events come back with
+// non-increasing sequence numbers, which means the underlying log is
+// corrupt.
+var ErrOutOfSequence = errors.New("transaction numbers out of sequence")
+
+type EventType byte
+
+const (
+	EventDelete EventType = 1
+	EventPut    EventType = 2
+
+	// EventTrash and EventUntrash were added after EventDelete and EventPut
+	// were already in use on disk, so they take new type values rather than
+	// reusing either. EventDelete itself keeps meaning "remove permanently"
+	// and is now written by the trash purge sweep rather than by the
+	// original delete handler.
+	EventTrash   EventType = 3
+	EventUntrash EventType = 4
+)
+
+// Event is a single recorded mutation. Timestamp is only meaningful for
+// EventTrash (the instant the key was trashed, used to compute when it's
+// eligible for purge); it is zero for every other event type. Lamport is
+// set by the cluster package when a node broadcasts a mutation to its
+// peers, for conflict resolution; it is not persisted to the log and is
+// zero for events read back from disk.
+type Event struct {
+	Sequence  uint64
+	EventType EventType
+	Key       string
+	Value     string
+	Timestamp int64
+	Lamport   uint64
+}
+
+// TransactionLogger durably records every mutation so the in-memory store
+// can be rebuilt on restart. Sequence numbers are assigned by the caller,
+// not minted by the logger: the in-memory store is the single source of
+// truth for "what sequence did this mutation get", so every Write* method
+// takes the sequence already assigned to it rather than inventing its own.
+// Implementations are expected to be safe for concurrent use by multiple
+// goroutines calling the Write* methods.
+type TransactionLogger interface {
+	WritePut(sequence uint64, key, value string)
+	WriteDelete(sequence uint64, key string)
+	WriteTrash(sequence uint64, key, value string, timestamp int64)
+	WriteUntrash(sequence uint64, key, value string)
+
+	// Err reports the channel that asynchronous write failures are
+	// delivered on.
+	Err() <-chan error
+
+	// Run starts the logger's background writer. It must be called once,
+	// before any Write* method.
+	Run()
+
+	// ReadEvents replays every recorded event, in sequence order, so the
+	// caller can rebuild the in-memory store after a restart.
+	ReadEvents() (<-chan Event, <-chan error)
+
+	// Close stops the background writer and releases the underlying
+	// storage. No further Write* calls are allowed once Close has been
+	// called.
+	Close() error
+}